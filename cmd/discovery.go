@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// discoveryInterval is how often a cached discovery's topology is refreshed
+// in the background. It is deliberately much longer than the metric scrape
+// interval since VS/RS configuration changes far less often than traffic
+// stats.
+const discoveryInterval = 5 * time.Minute
+
+// virtualServerInfo is the static configuration of a virtual server, keyed
+// by address/port so it can be correlated with the traffic statistics
+// returned by GetStatistics.
+type virtualServerInfo struct {
+	Name            string
+	Nickname        string
+	Protocol        string
+	Scheduler       string
+	Enabled         string
+	VSIndex         string
+	ConnectionLimit int
+}
+
+// realServerInfo is the static configuration of a real server, keyed by
+// vs_index/address/port since the same real server can back more than one
+// virtual service (e.g. an HTTP and HTTPS pair sharing a backend), and each
+// such attachment needs its own status and vs_index label.
+type realServerInfo struct {
+	Address  string
+	Port     string
+	Nickname string
+	Status   string
+	VSIndex  string
+}
+
+// discovery periodically refreshes the virtual/real server topology from the
+// Kemp API and exposes kemp_virtual_server_info / kemp_real_server_status,
+// deleting the label sets of servers that have since disappeared or whose
+// labels (such as a real server's status) have changed. One
+// discovery is kept per target/module for the life of the process (see
+// discoveryCache) so its refresh cadence can stay decoupled from, and much
+// longer than, the scrape cadence of /probe.
+type discovery struct {
+	client *kempClient
+
+	mu             sync.RWMutex
+	virtualServers map[string]virtualServerInfo
+	realServers    map[string]realServerInfo
+
+	virtualServerInfo *prometheus.GaugeVec
+	realServerStatus  *prometheus.GaugeVec
+}
+
+// newDiscovery creates a discovery subsystem for the given client. The
+// returned value must be registered with prometheus before use.
+func newDiscovery(client *kempClient) *discovery {
+	return &discovery{
+		client:         client,
+		virtualServers: map[string]virtualServerInfo{},
+		realServers:    map[string]realServerInfo{},
+
+		virtualServerInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kemp_virtual_server_info",
+			Help: "Static configuration of a virtual server. Always 1.",
+		}, []string{"address", "port", "name", "nickname", "protocol", "scheduler", "enabled", "vs_index"}),
+
+		realServerStatus: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kemp_real_server_status",
+			Help: "Status of a real server. 1 for the status the server currently has, one series per status label.",
+		}, []string{"address", "port", "nickname", "vs_index", "status"}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (d *discovery) Describe(ch chan<- *prometheus.Desc) {
+	d.virtualServerInfo.Describe(ch)
+	d.realServerStatus.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (d *discovery) Collect(ch chan<- prometheus.Metric) {
+	d.virtualServerInfo.Collect(ch)
+	d.realServerStatus.Collect(ch)
+}
+
+// runPeriodic refreshes the topology every discoveryInterval for the rest of
+// the process' life. Each refresh gets its own bounded context rather than
+// reusing any particular /probe request's deadline, since this loop outlives
+// every request that triggered it.
+func (d *discovery) runPeriodic() {
+	ticker := time.NewTicker(discoveryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultProbeTimeout)
+		d.refresh(ctx)
+		cancel()
+	}
+}
+
+// virtualServer returns the cached topology info for a virtual server, if
+// discovery has seen it.
+func (d *discovery) virtualServer(address string, port int) (virtualServerInfo, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	vs, ok := d.virtualServers[serverKey(address, port)]
+	return vs, ok
+}
+
+// realServer returns the cached topology info for a real server attached to
+// the given virtual server, if discovery has seen it. vsIndex is required
+// because the same address/port can be a real server of more than one
+// virtual service.
+func (d *discovery) realServer(vsIndex int, address string, port int) (realServerInfo, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	rs, ok := d.realServers[realServerKey(strconv.Itoa(vsIndex), address, strconv.Itoa(port))]
+	return rs, ok
+}
+
+func (d *discovery) refresh(ctx context.Context) {
+	services, err := d.client.listVirtualServices(ctx)
+	if err != nil {
+		log.Println("Error listing virtual services ", err)
+		return
+	}
+
+	virtualServers := map[string]virtualServerInfo{}
+	realServers := map[string]realServerInfo{}
+
+	for _, vs := range services {
+		vsIndex := strconv.Itoa(vs.ID)
+
+		connectionLimit := 0
+		for _, rs := range vs.Rs {
+			if limit, err := strconv.Atoi(rs.Limit); err == nil {
+				connectionLimit += limit
+			}
+		}
+
+		virtualServers[serverKeyString(vs.IPAddress, vs.Port)] = virtualServerInfo{
+			Name:            vs.Name,
+			Nickname:        vs.Name,
+			Protocol:        vs.Protocol,
+			Scheduler:       vs.Schedule,
+			Enabled:         vs.Enable,
+			VSIndex:         vsIndex,
+			ConnectionLimit: connectionLimit,
+		}
+
+		for _, rs := range vs.Rs {
+			realServers[realServerKey(vsIndex, rs.IPAddress, rs.Port)] = realServerInfo{
+				Address:  rs.IPAddress,
+				Port:     rs.Port,
+				Nickname: vs.Name,
+				Status:   realServerStatusLabel(rs.Status),
+				VSIndex:  vsIndex,
+			}
+		}
+	}
+
+	d.mu.Lock()
+	staleVirtualServers := d.virtualServers
+	staleRealServers := d.realServers
+	d.virtualServers = virtualServers
+	d.realServers = realServers
+	d.mu.Unlock()
+
+	for key, vs := range staleVirtualServers {
+		if current, ok := virtualServers[key]; ok && current == vs {
+			continue
+		}
+		address, port := splitServerKey(key)
+		d.virtualServerInfo.DeleteLabelValues(address, port, vs.Name, vs.Nickname, vs.Protocol, vs.Scheduler, vs.Enabled, vs.VSIndex)
+	}
+	for key, rs := range staleRealServers {
+		if current, ok := realServers[key]; ok && current == rs {
+			continue
+		}
+		d.realServerStatus.DeleteLabelValues(rs.Address, rs.Port, rs.Nickname, rs.VSIndex, rs.Status)
+	}
+
+	for key, vs := range virtualServers {
+		address, port := splitServerKey(key)
+		d.virtualServerInfo.WithLabelValues(address, port, vs.Name, vs.Nickname, vs.Protocol, vs.Scheduler, vs.Enabled, vs.VSIndex).Set(1)
+	}
+	for _, rs := range realServers {
+		d.realServerStatus.WithLabelValues(rs.Address, rs.Port, rs.Nickname, rs.VSIndex, rs.Status).Set(1)
+	}
+}
+
+// discoveries caches one discovery per target/module across /probe requests,
+// so topology is refreshed on discoveryInterval instead of once per scrape.
+var discoveries = &discoveryCache{entries: map[string]*discovery{}}
+
+// discoveryCache hands out a long-lived discovery per cache key, creating
+// and seeding it on first use.
+type discoveryCache struct {
+	mu      sync.Mutex
+	entries map[string]*discovery
+}
+
+// get returns the cached discovery for key, creating it if this is the first
+// time key has been probed. A new discovery is refreshed synchronously
+// (bounded by ctx, the requesting probe's deadline) so the first scrape of a
+// target isn't missing topology, then handed a background refresh loop for
+// every scrape after that.
+func (dc *discoveryCache) get(ctx context.Context, key string, client *kempClient) *discovery {
+	dc.mu.Lock()
+	if d, ok := dc.entries[key]; ok {
+		dc.mu.Unlock()
+		return d
+	}
+	d := newDiscovery(client)
+	dc.entries[key] = d
+	dc.mu.Unlock()
+
+	d.refresh(ctx)
+	go d.runPeriodic()
+	return d
+}
+
+// realServerKey returns the cache key for a real server attachment: the
+// vs_index of the virtual service it backs, plus its own address/port, so
+// the same real server shared by multiple virtual services gets one entry
+// per attachment instead of clobbering by address/port alone.
+func realServerKey(vsIndex, address, port string) string {
+	return vsIndex + "|" + serverKeyString(address, port)
+}
+
+func serverKey(address string, port int) string {
+	return serverKeyString(address, strconv.Itoa(port))
+}
+
+func serverKeyString(address, port string) string {
+	return address + ":" + port
+}
+
+func splitServerKey(key string) (address, port string) {
+	idx := strings.LastIndex(key, ":")
+	return key[:idx], key[idx+1:]
+}
+
+// realServerStatusLabel translates the Kemp API's numeric real-server status
+// code into the human-readable value exposed on kemp_real_server_status.
+func realServerStatusLabel(status string) string {
+	switch status {
+	case "1":
+		return "up"
+	case "2":
+		return "down"
+	case "3":
+		return "disabled"
+	default:
+		return status
+	}
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import "testing"
+
+func TestRealServerStatusLabel(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{"1", "up"},
+		{"2", "down"},
+		{"3", "disabled"},
+		{"99", "99"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			if got := realServerStatusLabel(tt.status); got != tt.want {
+				t.Errorf("realServerStatusLabel(%q) = %q, want %q", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRealServerKey(t *testing.T) {
+	// A real server backing two virtual services must not collide on the
+	// same cache key, since each attachment needs its own status/vs_index.
+	a := realServerKey("1", "10.0.0.1", "80")
+	b := realServerKey("2", "10.0.0.1", "80")
+
+	if a == b {
+		t.Fatalf("realServerKey produced the same key for different vs_index: %q", a)
+	}
+}
+
+func TestSplitServerKey(t *testing.T) {
+	address, port := splitServerKey(serverKeyString("10.0.0.1", "443"))
+	if address != "10.0.0.1" || port != "443" {
+		t.Errorf("splitServerKey round-trip = (%q, %q), want (\"10.0.0.1\", \"443\")", address, port)
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+
+	kemp "github.com/giantswarm/kemp-client"
+	"github.com/rogpeppe/go-charset/charset"
+	_ "github.com/rogpeppe/go-charset/data"
+)
+
+// kempClient is a context-aware fork of the two read calls this exporter
+// needs from kemp.Client (github.com/giantswarm/kemp-client). The vendored
+// Request method builds its own *http.Client per call with no Timeout and no
+// context support, so a probe of an unreachable LoadMaster can never
+// actually be cancelled: the dial/read keeps running, and leaks, long after
+// probeHandler gives up on it and writes a 504. Threading ctx through the
+// request lets net/http abort the connection the moment the probe (or
+// Prometheus' own scrape) times out.
+type kempClient struct {
+	endpoint string
+	user     string
+	password string
+	debug    bool
+}
+
+func newKempClient(endpoint, user, password string, debug bool) *kempClient {
+	return &kempClient{endpoint: endpoint, user: user, password: password, debug: debug}
+}
+
+// listVirtualServices is kemp.Client.ListVirtualServices, bounded by ctx.
+func (c *kempClient) listVirtualServices(ctx context.Context) ([]kemp.VirtualService, error) {
+	data := kemp.VirtualServiceListResponse{}
+	if err := c.request(ctx, "listvs", nil, &data); err != nil {
+		return nil, fmt.Errorf("kemp could not list virtual services: %w", err)
+	}
+
+	if c.debug {
+		log.Println("DEBUG:", data.Debug)
+	}
+
+	return data.Data.VS, nil
+}
+
+// getStatistics is kemp.Client.GetStatistics, bounded by ctx.
+func (c *kempClient) getStatistics(ctx context.Context) (kemp.Statistics, error) {
+	data := kemp.StatisticsResponse{}
+	if err := c.request(ctx, "stats", nil, &data); err != nil {
+		return kemp.Statistics{}, fmt.Errorf("kemp could not return stats: %w", err)
+	}
+
+	if c.debug {
+		log.Println("DEBUG:", data.Debug)
+	}
+
+	sort.Sort(data.Data.VirtualServices)
+	sort.Sort(data.Data.RealServers)
+
+	return data.Data, nil
+}
+
+// request is kemp.Client.Request, reforked to accept a context so the
+// in-flight HTTP call is cancelled as soon as ctx expires instead of
+// outliving the caller indefinitely.
+func (c *kempClient) request(ctx context.Context, cmd string, parameters map[string]string, data interface{}) error {
+	params := url.Values{}
+	for key, val := range parameters {
+		params.Set(key, val)
+	}
+
+	requestURL := fmt.Sprintf("%s%s?%s", c.endpoint, cmd, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return fmt.Errorf("kemp request to %q failed: %w", requestURL, err)
+	}
+	req.SetBasicAuth(c.user, c.password)
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("kemp request to %q failed: %w", requestURL, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		errResponse := kemp.ErrorResponse{}
+		if err := decodeXML(res.Body, &errResponse); err != nil {
+			return fmt.Errorf("kemp unable to parse error response: %w", err)
+		}
+		return fmt.Errorf("%d - %s", res.StatusCode, errResponse.Error)
+	}
+
+	if err := decodeXML(res.Body, data); err != nil {
+		return fmt.Errorf("kemp unable to parse response: %w", err)
+	}
+
+	return nil
+}
+
+func decodeXML(r io.Reader, v interface{}) error {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReader
+	return decoder.Decode(v)
+}
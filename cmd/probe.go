@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/zwb-github/prometheus-kemp-exporter/config"
+)
+
+// defaultModule is used when the request does not specify a module.
+const defaultModule = "default"
+
+// defaultProbeTimeout bounds a probe when neither the module config nor
+// Prometheus' scrape timeout header supply one.
+const defaultProbeTimeout = 10 * time.Second
+
+// probeResult carries the outcome of scraping a single target back out of
+// the timeout goroutine in probeHandler.
+type probeResult struct {
+	mfs []*dto.MetricFamily
+	up  float64
+	err error
+}
+
+// probeHandler returns an http.HandlerFunc implementing the
+// blackbox_exporter-style /probe endpoint: it scrapes a single target using
+// the credentials configured for the requested module and renders the
+// result as its own, self-contained set of metrics, bounded by the
+// module's (or Prometheus') scrape timeout.
+func probeHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		probesTotal.Inc()
+
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+
+		moduleName := r.URL.Query().Get("module")
+		if moduleName == "" {
+			moduleName = defaultModule
+		}
+
+		module, err := cfg.Module(moduleName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), probeTimeout(r, module))
+		defer cancel()
+
+		client := newKempClient(target, module.Username, module.Password, debug)
+
+		start := time.Now()
+		resultCh := make(chan probeResult, 1)
+		go func() {
+			resultCh <- probeTarget(ctx, client, target, moduleName)
+		}()
+
+		var result probeResult
+		select {
+		case result = <-resultCh:
+		case <-ctx.Done():
+			scrapeErrors.WithLabelValues(target).Inc()
+			http.Error(w, "probe timed out: "+ctx.Err().Error(), http.StatusGatewayTimeout)
+			return
+		}
+		duration := time.Since(start).Seconds()
+		scrapeDuration.WithLabelValues(target).Observe(duration)
+
+		if result.err != nil {
+			scrapeErrors.WithLabelValues(target).Inc()
+			http.Error(w, result.err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if result.up == 0 {
+			scrapeErrors.WithLabelValues(target).Inc()
+		}
+
+		probeRegistry := prometheus.NewRegistry()
+		probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "kemp_probe_success",
+			Help: "Whether the probe of the target succeeded.",
+		})
+		probeDurationSeconds := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "kemp_probe_duration_seconds",
+			Help: "How long the probe of the target took in seconds.",
+		})
+		probeDurationSeconds.Set(duration)
+		probeSuccess.Set(result.up)
+		probeRegistry.MustRegister(probeSuccess)
+		probeRegistry.MustRegister(probeDurationSeconds)
+
+		probeMfs, err := probeRegistry.Gather()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		contentType := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(contentType))
+		enc := expfmt.NewEncoder(w, contentType)
+		for _, mf := range append(result.mfs, probeMfs...) {
+			if err := enc.Encode(mf); err != nil {
+				log.Println("Error encoding probe metric family ", err)
+				return
+			}
+		}
+	}
+}
+
+// probeTarget scrapes the discovery topology and live statistics of a single
+// target and renders them as metric families, independent of the default
+// registry used by /metrics. ctx bounds every Kemp API call made along the
+// way, so a probe that times out actually cancels its in-flight HTTP
+// request instead of leaking it. discovery is shared across probes of the
+// same target/module via discoveries, so its refresh cadence can stay
+// decoupled from the scrape cadence of /probe.
+func probeTarget(ctx context.Context, client *kempClient, target, moduleName string) probeResult {
+	registry := prometheus.NewRegistry()
+
+	discovery := discoveries.get(ctx, target+"|"+moduleName, client)
+	registry.MustRegister(discovery)
+
+	collector := NewKempCollector(ctx, client, discovery)
+	registry.MustRegister(collector)
+
+	mfs, err := registry.Gather()
+	return probeResult{mfs: mfs, up: collector.Up(), err: err}
+}
+
+// probeTimeout determines how long a single probe may run, preferring the
+// Prometheus-supplied scrape timeout header over the module's configured
+// default.
+func probeTimeout(r *http.Request, module config.Module) time.Duration {
+	if header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); header != "" {
+		if seconds, err := strconv.ParseFloat(header, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	if module.Timeout > 0 {
+		return time.Duration(module.Timeout) * time.Second
+	}
+
+	return defaultProbeTimeout
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zwb-github/prometheus-kemp-exporter/config"
+)
+
+func TestProbeTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		module     config.Module
+		wantResult time.Duration
+	}{
+		{
+			name:       "prometheus header wins",
+			header:     "5",
+			module:     config.Module{Timeout: 20},
+			wantResult: 5 * time.Second,
+		},
+		{
+			name:       "module timeout used when no header",
+			module:     config.Module{Timeout: 20},
+			wantResult: 20 * time.Second,
+		},
+		{
+			name:       "default timeout when neither is set",
+			module:     config.Module{},
+			wantResult: defaultProbeTimeout,
+		},
+		{
+			name:       "invalid header falls back to module timeout",
+			header:     "not-a-number",
+			module:     config.Module{Timeout: 20},
+			wantResult: 20 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/probe", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", tt.header)
+			}
+
+			if got := probeTimeout(r, tt.module); got != tt.wantResult {
+				t.Errorf("probeTimeout() = %v, want %v", got, tt.wantResult)
+			}
+		})
+	}
+}
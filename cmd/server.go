@@ -1,187 +1,316 @@
 package cmd
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
-	"time"
 
-	kemp "github.com/giantswarm/kemp-client"
+	kitlog "github.com/go-kit/log"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/spf13/cobra"
+
+	"github.com/zwb-github/prometheus-kemp-exporter/config"
 )
 
 var (
 	serverCmd = &cobra.Command{
-		Use:   "server [endpoint] [username] [password]",
+		Use:   "server",
 		Short: "Start the HTTP server",
 		Run:   serverRun,
 	}
 
-	debug       bool
-	waitSeconds int
-	port        int
+	debug         bool
+	port          int
+	configFile    string
+	webConfigFile string
 
-	connsPerSec = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "kemp_totals_connections_per_second",
-		Help: "The number of connections per second.",
-	})
-	bytesPerSec = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "kemp_totals_bytes_per_second",
-		Help: "The number of bytes per second.",
-	})
-	packetsPerSec = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "kemp_totals_packets_per_second",
-		Help: "The number of packets per second.",
+	probesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kemp_exporter_probes_total",
+		Help: "The total number of /probe requests handled by this exporter.",
 	})
 
-	virtualServerTotalConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_virtual_server_total_connections",
-		Help: "The number of total connections per virtual server.",
-	}, []string{"address", "port"})
-	virtualServerTotalPackets = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_virtual_server_total_packets",
-		Help: "The number of total packets per virtual server.",
-	}, []string{"address", "port"})
-	virtualServerTotalBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_virtual_server_total_bytes",
-		Help: "The number of total bytes per virtual server.",
-	}, []string{"address", "port"})
-	virtualServerActiveConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_virtual_server_active_connections",
-		Help: "The number of active connections per virtual server.",
-	}, []string{"address", "port"})
-	virtualServerConnsPerSec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_virtual_server_connections_per_second",
-		Help: "The number of connections per second per virtual server.",
-	}, []string{"address", "port"})
-	virtualServerBytesRead = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_virtual_server_bytes_read",
-		Help: "The number of bytes read per virtual server.",
-	}, []string{"address", "port"})
-	virtualServerBytesWritten = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_virtual_server_bytes_written",
-		Help: "The number of bytes written per virtual server",
-	}, []string{"address", "port"})
-
-	realServerTotalConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_real_server_total_connections",
-		Help: "The number of total connections per real server.",
-	}, []string{"address", "port"})
-	realServerTotalPackets = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_real_server_total_packets",
-		Help: "The number of total packets per real server.",
-	}, []string{"address", "port"})
-	realServerTotalBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_real_server_total_bytes",
-		Help: "The number of total bytes per real server.",
-	}, []string{"address", "port"})
-	realServerActiveConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_real_server_active_connections",
-		Help: "The number of active connections per real server.",
-	}, []string{"address", "port"})
-	realServerConnsPerSec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_real_server_connections_per_second",
-		Help: "The number of connections per second per real server.",
-	}, []string{"address", "port"})
-	realServerBytesRead = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_real_server_bytes_read",
-		Help: "The number of bytes read per real server.",
-	}, []string{"address", "port"})
-	realServerBytesWritten = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "kemp_real_server_bytes_written",
-		Help: "The number of bytes written per real server",
-	}, []string{"address", "port"})
+	scrapeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "kemp_scrape_duration_seconds",
+		Help: "How long a probe's scrape of a target's Kemp API took, in seconds.",
+	}, []string{"target"})
+
+	scrapeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kemp_scrape_errors_total",
+		Help: "The total number of probes that failed to reach or parse a response from a target's Kemp API.",
+	}, []string{"target"})
 )
 
+var (
+	virtualServerLabels = []string{"address", "port", "name", "nickname", "protocol", "scheduler", "enabled", "vs_index"}
+	realServerLabels    = []string{"address", "port", "nickname", "vs_index", "status"}
+)
+
+// KempCollector implements prometheus.Collector, querying the Kemp API
+// synchronously on every scrape rather than polling on a timer, so metric
+// values always match the state of the LoadMaster at scrape time.
+type KempCollector struct {
+	ctx       context.Context
+	client    *kempClient
+	discovery *discovery
+
+	lastUp float64
+
+	up *prometheus.Desc
+
+	connsPerSec   *prometheus.Desc
+	bytesPerSec   *prometheus.Desc
+	packetsPerSec *prometheus.Desc
+
+	virtualServerTotalConnections  *prometheus.Desc
+	virtualServerTotalPackets      *prometheus.Desc
+	virtualServerTotalBytes        *prometheus.Desc
+	virtualServerActiveConnections *prometheus.Desc
+	virtualServerConnsPerSec       *prometheus.Desc
+	virtualServerBytesRead         *prometheus.Desc
+	virtualServerBytesWritten      *prometheus.Desc
+
+	realServerTotalConnections  *prometheus.Desc
+	realServerTotalPackets      *prometheus.Desc
+	realServerTotalBytes        *prometheus.Desc
+	realServerActiveConnections *prometheus.Desc
+	realServerConnsPerSec       *prometheus.Desc
+	realServerBytesRead         *prometheus.Desc
+	realServerBytesWritten      *prometheus.Desc
+
+	virtualServerRealServersUp             *prometheus.Desc
+	virtualServerRealServersTotal          *prometheus.Desc
+	virtualServerAvailabilityRatio         *prometheus.Desc
+	virtualServerConnectionSaturationRatio *prometheus.Desc
+}
+
+// vsAggregate accumulates the real-server counts for a single virtual
+// server, correlated by vs_index, so SLI metrics can be derived without a
+// PromQL join across the flattened virtualServer*/realServer* series.
+type vsAggregate struct {
+	realServersUp    int
+	realServersTotal int
+}
+
+// NewKempCollector returns a KempCollector that scrapes the given client,
+// correlating each virtual/real server with the topology cached by
+// discovery. ctx bounds the Kemp API call made by Collect, since
+// prometheus.Collector.Collect has no context parameter of its own.
+func NewKempCollector(ctx context.Context, client *kempClient, discovery *discovery) *KempCollector {
+	return &KempCollector{
+		ctx:       ctx,
+		client:    client,
+		discovery: discovery,
+
+		up: prometheus.NewDesc("kemp_up", "Whether the last scrape of the Kemp API succeeded.", nil, nil),
+
+		connsPerSec:   prometheus.NewDesc("kemp_totals_connections_per_second", "The number of connections per second.", nil, nil),
+		bytesPerSec:   prometheus.NewDesc("kemp_totals_bytes_per_second", "The number of bytes per second.", nil, nil),
+		packetsPerSec: prometheus.NewDesc("kemp_totals_packets_per_second", "The number of packets per second.", nil, nil),
+
+		virtualServerTotalConnections:  prometheus.NewDesc("kemp_virtual_server_total_connections_total", "The cumulative number of connections per virtual server.", virtualServerLabels, nil),
+		virtualServerTotalPackets:      prometheus.NewDesc("kemp_virtual_server_total_packets_total", "The cumulative number of packets per virtual server.", virtualServerLabels, nil),
+		virtualServerTotalBytes:        prometheus.NewDesc("kemp_virtual_server_total_bytes_total", "The cumulative number of bytes per virtual server.", virtualServerLabels, nil),
+		virtualServerActiveConnections: prometheus.NewDesc("kemp_virtual_server_active_connections", "The number of active connections per virtual server.", virtualServerLabels, nil),
+		virtualServerConnsPerSec:       prometheus.NewDesc("kemp_virtual_server_connections_per_second", "The number of connections per second per virtual server.", virtualServerLabels, nil),
+		virtualServerBytesRead:         prometheus.NewDesc("kemp_virtual_server_bytes_read_total", "The cumulative number of bytes read per virtual server.", virtualServerLabels, nil),
+		virtualServerBytesWritten:      prometheus.NewDesc("kemp_virtual_server_bytes_written_total", "The cumulative number of bytes written per virtual server.", virtualServerLabels, nil),
+
+		realServerTotalConnections:  prometheus.NewDesc("kemp_real_server_total_connections_total", "The cumulative number of connections per real server.", realServerLabels, nil),
+		realServerTotalPackets:      prometheus.NewDesc("kemp_real_server_total_packets_total", "The cumulative number of packets per real server.", realServerLabels, nil),
+		realServerTotalBytes:        prometheus.NewDesc("kemp_real_server_total_bytes_total", "The cumulative number of bytes per real server.", realServerLabels, nil),
+		realServerActiveConnections: prometheus.NewDesc("kemp_real_server_active_connections", "The number of active connections per real server.", realServerLabels, nil),
+		realServerConnsPerSec:       prometheus.NewDesc("kemp_real_server_connections_per_second", "The number of connections per second per real server.", realServerLabels, nil),
+		realServerBytesRead:         prometheus.NewDesc("kemp_real_server_bytes_read_total", "The cumulative number of bytes read per real server.", realServerLabels, nil),
+		realServerBytesWritten:      prometheus.NewDesc("kemp_real_server_bytes_written_total", "The cumulative number of bytes written per real server.", realServerLabels, nil),
+
+		virtualServerRealServersUp:             prometheus.NewDesc("kemp_virtual_server_real_servers_up", "The number of real servers that are up behind a virtual server.", virtualServerLabels, nil),
+		virtualServerRealServersTotal:          prometheus.NewDesc("kemp_virtual_server_real_servers_total", "The total number of real servers behind a virtual server.", virtualServerLabels, nil),
+		virtualServerAvailabilityRatio:         prometheus.NewDesc("kemp_virtual_server_availability_ratio", "The ratio of real servers that are up to the total behind a virtual server.", virtualServerLabels, nil),
+		virtualServerConnectionSaturationRatio: prometheus.NewDesc("kemp_virtual_server_connection_saturation_ratio", "The ratio of active connections to the configured connection limit of a virtual server.", virtualServerLabels, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *KempCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+
+	ch <- c.connsPerSec
+	ch <- c.bytesPerSec
+	ch <- c.packetsPerSec
+
+	ch <- c.virtualServerTotalConnections
+	ch <- c.virtualServerTotalPackets
+	ch <- c.virtualServerTotalBytes
+	ch <- c.virtualServerActiveConnections
+	ch <- c.virtualServerConnsPerSec
+	ch <- c.virtualServerBytesRead
+	ch <- c.virtualServerBytesWritten
+
+	ch <- c.realServerTotalConnections
+	ch <- c.realServerTotalPackets
+	ch <- c.realServerTotalBytes
+	ch <- c.realServerActiveConnections
+	ch <- c.realServerConnsPerSec
+	ch <- c.realServerBytesRead
+	ch <- c.realServerBytesWritten
+
+	ch <- c.virtualServerRealServersUp
+	ch <- c.virtualServerRealServersTotal
+	ch <- c.virtualServerAvailabilityRatio
+	ch <- c.virtualServerConnectionSaturationRatio
+}
+
+// Collect implements prometheus.Collector, calling the Kemp API once per
+// scrape and translating the response into metrics.
+func (c *KempCollector) Collect(ch chan<- prometheus.Metric) {
+	statistics, err := c.client.getStatistics(c.ctx)
+	if err != nil {
+		log.Println("Error getting statistics ", err)
+		c.lastUp = 0
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, c.lastUp)
+		return
+	}
+	c.lastUp = 1
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, c.lastUp)
+
+	ch <- prometheus.MustNewConstMetric(c.connsPerSec, prometheus.GaugeValue, float64(statistics.Totals.ConnectionsPerSec))
+	ch <- prometheus.MustNewConstMetric(c.bytesPerSec, prometheus.GaugeValue, float64(statistics.Totals.BytesPerSec))
+	ch <- prometheus.MustNewConstMetric(c.packetsPerSec, prometheus.GaugeValue, float64(statistics.Totals.PacketsPerSec))
+
+	aggregates := map[string]vsAggregate{}
+
+	for _, rs := range statistics.RealServers {
+		info, _ := c.discovery.realServer(rs.VSIndex, rs.Address, rs.Port)
+		labels := []string{rs.Address, strconv.Itoa(rs.Port), info.Nickname, info.VSIndex, info.Status}
+
+		ch <- prometheus.MustNewConstMetric(c.realServerTotalConnections, prometheus.CounterValue, float64(rs.TotalConnections), labels...)
+		ch <- prometheus.MustNewConstMetric(c.realServerTotalPackets, prometheus.CounterValue, float64(rs.TotalPackets), labels...)
+		ch <- prometheus.MustNewConstMetric(c.realServerTotalBytes, prometheus.CounterValue, float64(rs.TotalBytes), labels...)
+		ch <- prometheus.MustNewConstMetric(c.realServerActiveConnections, prometheus.GaugeValue, float64(rs.ActiveConnections), labels...)
+		ch <- prometheus.MustNewConstMetric(c.realServerConnsPerSec, prometheus.GaugeValue, float64(rs.ConnectionsPerSec), labels...)
+		ch <- prometheus.MustNewConstMetric(c.realServerBytesRead, prometheus.CounterValue, float64(rs.BytesRead), labels...)
+		ch <- prometheus.MustNewConstMetric(c.realServerBytesWritten, prometheus.CounterValue, float64(rs.BytesWritten), labels...)
+
+		addRealServerToAggregate(aggregates, info.VSIndex, info.Status)
+	}
+
+	for _, vs := range statistics.VirtualServices {
+		info, _ := c.discovery.virtualServer(vs.Address, vs.Port)
+		labels := []string{vs.Address, strconv.Itoa(vs.Port), info.Name, info.Nickname, info.Protocol, info.Scheduler, info.Enabled, info.VSIndex}
+
+		ch <- prometheus.MustNewConstMetric(c.virtualServerTotalConnections, prometheus.CounterValue, float64(vs.TotalConnections), labels...)
+		ch <- prometheus.MustNewConstMetric(c.virtualServerTotalPackets, prometheus.CounterValue, float64(vs.TotalPackets), labels...)
+		ch <- prometheus.MustNewConstMetric(c.virtualServerTotalBytes, prometheus.CounterValue, float64(vs.TotalBytes), labels...)
+		ch <- prometheus.MustNewConstMetric(c.virtualServerActiveConnections, prometheus.GaugeValue, float64(vs.ActiveConnections), labels...)
+		ch <- prometheus.MustNewConstMetric(c.virtualServerConnsPerSec, prometheus.GaugeValue, float64(vs.ConnectionsPerSec), labels...)
+		ch <- prometheus.MustNewConstMetric(c.virtualServerBytesRead, prometheus.CounterValue, float64(vs.BytesRead), labels...)
+		ch <- prometheus.MustNewConstMetric(c.virtualServerBytesWritten, prometheus.CounterValue, float64(vs.BytesWritten), labels...)
+
+		agg := aggregates[info.VSIndex]
+		ch <- prometheus.MustNewConstMetric(c.virtualServerRealServersUp, prometheus.GaugeValue, float64(agg.realServersUp), labels...)
+		ch <- prometheus.MustNewConstMetric(c.virtualServerRealServersTotal, prometheus.GaugeValue, float64(agg.realServersTotal), labels...)
+		if ratio, ok := agg.availabilityRatio(); ok {
+			ch <- prometheus.MustNewConstMetric(c.virtualServerAvailabilityRatio, prometheus.GaugeValue, ratio, labels...)
+		}
+		if saturation, ok := connectionSaturationRatio(vs.ActiveConnections, info.ConnectionLimit); ok {
+			ch <- prometheus.MustNewConstMetric(c.virtualServerConnectionSaturationRatio, prometheus.GaugeValue, saturation, labels...)
+		}
+	}
+}
+
+// addRealServerToAggregate folds one real server's status into the
+// aggregate kept for its virtual server, leaving servers with no known
+// vs_index (not found by discovery) out of the SLI entirely.
+func addRealServerToAggregate(aggregates map[string]vsAggregate, vsIndex, status string) {
+	if vsIndex == "" {
+		return
+	}
+	agg := aggregates[vsIndex]
+	agg.realServersTotal++
+	if status == "up" {
+		agg.realServersUp++
+	}
+	aggregates[vsIndex] = agg
+}
+
+// availabilityRatio returns the fraction of a virtual server's real servers
+// that are up. ok is false when there are no real servers to divide by.
+func (a vsAggregate) availabilityRatio() (ratio float64, ok bool) {
+	if a.realServersTotal == 0 {
+		return 0, false
+	}
+	return float64(a.realServersUp) / float64(a.realServersTotal), true
+}
+
+// connectionSaturationRatio returns the fraction of a virtual server's
+// connection limit currently in use. ok is false when the virtual server has
+// no configured limit.
+func connectionSaturationRatio(activeConnections, connectionLimit int) (ratio float64, ok bool) {
+	if connectionLimit <= 0 {
+		return 0, false
+	}
+	return float64(activeConnections) / float64(connectionLimit), true
+}
+
+// Up reports whether the most recent scrape performed by this collector
+// succeeded. It is only meaningful after Collect has run at least once.
+func (c *KempCollector) Up() float64 {
+	return c.lastUp
+}
+
 func init() {
 	RootCmd.AddCommand(serverCmd)
 
 	serverCmd.Flags().IntVar(&port, "port", 8000, "port to listen on")
-	serverCmd.Flags().IntVar(&waitSeconds, "wait", 10, "time (in seconds) between accessing the Kemp API")
 	serverCmd.Flags().BoolVar(&debug, "debug", false, "enable debug output")
-
-	prometheus.MustRegister(connsPerSec)
-	prometheus.MustRegister(bytesPerSec)
-	prometheus.MustRegister(packetsPerSec)
-
-	prometheus.MustRegister(virtualServerTotalConnections)
-	prometheus.MustRegister(virtualServerTotalPackets)
-	prometheus.MustRegister(virtualServerTotalBytes)
-	prometheus.MustRegister(virtualServerActiveConnections)
-	prometheus.MustRegister(virtualServerConnsPerSec)
-	prometheus.MustRegister(virtualServerBytesRead)
-	prometheus.MustRegister(virtualServerBytesWritten)
-
-	prometheus.MustRegister(realServerTotalConnections)
-	prometheus.MustRegister(realServerTotalPackets)
-	prometheus.MustRegister(realServerTotalBytes)
-	prometheus.MustRegister(realServerActiveConnections)
-	prometheus.MustRegister(realServerConnsPerSec)
-	prometheus.MustRegister(realServerBytesRead)
-	prometheus.MustRegister(realServerBytesWritten)
+	serverCmd.Flags().StringVar(&configFile, "config.file", "kemp-exporter.yml", "path to the module configuration file")
+	serverCmd.Flags().StringVar(&webConfigFile, "web.config.file", "", "path to a file enabling TLS or basic auth for /metrics and /probe")
 }
 
 func serverRun(cmd *cobra.Command, args []string) {
 	flag.Parse()
 
-	if len(cmd.Flags().Args()) != 3 {
-		cmd.Help()
-		os.Exit(1)
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		log.Fatal("Error loading config file ", configFile, ": ", err)
 	}
 
-	client := kemp.NewClient(kemp.Config{
-		Endpoint: flag.Arg(1),
-		User:     flag.Arg(2),
-		Password: flag.Arg(3),
-		Debug:    debug,
+	prometheus.MustRegister(probesTotal)
+	prometheus.MustRegister(scrapeDuration)
+	prometheus.MustRegister(scrapeErrors)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html>
+<head><title>Kemp Exporter</title></head>
+<body>
+<h1>Kemp Exporter</h1>
+<p><a href="/probe?target=kemp.example.com&module=default">Probe a target</a></p>
+<p><a href="/metrics">Exporter metrics</a></p>
+</body>
+</html>`)
 	})
+	mux.Handle("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+	}))
+	mux.HandleFunc("/probe", probeHandler(cfg))
 
-	go func() {
-		for {
-			statistics, err := client.GetStatistics()
-			if err != nil {
-				log.Println("Error getting statistics ", err)
-				os.Exit(1)
-			}
-
-			connsPerSec.Set(float64(statistics.Totals.ConnectionsPerSec))
-			bytesPerSec.Set(float64(statistics.Totals.BytesPerSec))
-			packetsPerSec.Set(float64(statistics.Totals.PacketsPerSec))
-
-			for _, vs := range statistics.VirtualServers {
-				virtualServerTotalConnections.WithLabelValues(vs.Address, strconv.Itoa(vs.Port)).Set(float64(vs.TotalConnections))
-				virtualServerTotalPackets.WithLabelValues(vs.Address, strconv.Itoa(vs.Port)).Set(float64(vs.TotalPackets))
-				virtualServerTotalBytes.WithLabelValues(vs.Address, strconv.Itoa(vs.Port)).Set(float64(vs.TotalBytes))
-				virtualServerActiveConnections.WithLabelValues(vs.Address, strconv.Itoa(vs.Port)).Set(float64(vs.ActiveConnections))
-				virtualServerConnsPerSec.WithLabelValues(vs.Address, strconv.Itoa(vs.Port)).Set(float64(vs.ConnectionsPerSec))
-				virtualServerBytesRead.WithLabelValues(vs.Address, strconv.Itoa(vs.Port)).Set(float64(vs.BytesRead))
-				virtualServerBytesWritten.WithLabelValues(vs.Address, strconv.Itoa(vs.Port)).Set(float64(vs.BytesWritten))
-			}
-
-			for _, rs := range statistics.RealServers {
-				realServerTotalConnections.WithLabelValues(rs.Address, strconv.Itoa(rs.Port)).Set(float64(rs.TotalConnections))
-				realServerTotalPackets.WithLabelValues(rs.Address, strconv.Itoa(rs.Port)).Set(float64(rs.TotalPackets))
-				realServerTotalBytes.WithLabelValues(rs.Address, strconv.Itoa(rs.Port)).Set(float64(rs.TotalBytes))
-				realServerActiveConnections.WithLabelValues(rs.Address, strconv.Itoa(rs.Port)).Set(float64(rs.ActiveConnections))
-				realServerConnsPerSec.WithLabelValues(rs.Address, strconv.Itoa(rs.Port)).Set(float64(rs.ConnectionsPerSec))
-				realServerBytesRead.WithLabelValues(rs.Address, strconv.Itoa(rs.Port)).Set(float64(rs.BytesRead))
-				realServerBytesWritten.WithLabelValues(rs.Address, strconv.Itoa(rs.Port)).Set(float64(rs.BytesWritten))
-			}
-
-			time.Sleep(time.Second * time.Duration(waitSeconds))
-		}
-	}()
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}
+	flagConfig := &web.FlagConfig{
+		WebListenAddresses: &[]string{fmt.Sprintf(":%d", port)},
+		WebConfigFile:      &webConfigFile,
+	}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, "")
-	})
-	http.Handle("/metrics", prometheus.Handler())
+	logger := kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(os.Stderr))
 
 	log.Print("Listening on port ", port)
-
-	http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+	if err := web.ListenAndServe(srv, flagConfig, logger); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,109 @@
+package cmd
+
+import "testing"
+
+func TestAddRealServerToAggregate(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []struct{ vsIndex, status string }
+		want    map[string]vsAggregate
+	}{
+		{
+			name: "single vs, mixed statuses",
+			entries: []struct{ vsIndex, status string }{
+				{"1", "up"},
+				{"1", "down"},
+				{"1", "up"},
+			},
+			want: map[string]vsAggregate{
+				"1": {realServersUp: 2, realServersTotal: 3},
+			},
+		},
+		{
+			name: "real server shared by two virtual services",
+			entries: []struct{ vsIndex, status string }{
+				{"1", "up"},
+				{"2", "up"},
+			},
+			want: map[string]vsAggregate{
+				"1": {realServersUp: 1, realServersTotal: 1},
+				"2": {realServersUp: 1, realServersTotal: 1},
+			},
+		},
+		{
+			name: "unknown vs_index is ignored",
+			entries: []struct{ vsIndex, status string }{
+				{"", "up"},
+				{"1", "up"},
+			},
+			want: map[string]vsAggregate{
+				"1": {realServersUp: 1, realServersTotal: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregates := map[string]vsAggregate{}
+			for _, e := range tt.entries {
+				addRealServerToAggregate(aggregates, e.vsIndex, e.status)
+			}
+
+			if len(aggregates) != len(tt.want) {
+				t.Fatalf("aggregates = %+v, want %+v", aggregates, tt.want)
+			}
+			for vsIndex, want := range tt.want {
+				if got := aggregates[vsIndex]; got != want {
+					t.Errorf("aggregates[%q] = %+v, want %+v", vsIndex, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVSAggregateAvailabilityRatio(t *testing.T) {
+	tests := []struct {
+		name      string
+		agg       vsAggregate
+		wantRatio float64
+		wantOK    bool
+	}{
+		{name: "all up", agg: vsAggregate{realServersUp: 3, realServersTotal: 3}, wantRatio: 1, wantOK: true},
+		{name: "half up", agg: vsAggregate{realServersUp: 1, realServersTotal: 2}, wantRatio: 0.5, wantOK: true},
+		{name: "none up", agg: vsAggregate{realServersUp: 0, realServersTotal: 2}, wantRatio: 0, wantOK: true},
+		{name: "no real servers", agg: vsAggregate{}, wantRatio: 0, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratio, ok := tt.agg.availabilityRatio()
+			if ok != tt.wantOK || ratio != tt.wantRatio {
+				t.Errorf("availabilityRatio() = (%v, %v), want (%v, %v)", ratio, ok, tt.wantRatio, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestConnectionSaturationRatio(t *testing.T) {
+	tests := []struct {
+		name              string
+		activeConnections int
+		connectionLimit   int
+		wantRatio         float64
+		wantOK            bool
+	}{
+		{name: "under limit", activeConnections: 50, connectionLimit: 100, wantRatio: 0.5, wantOK: true},
+		{name: "over limit", activeConnections: 150, connectionLimit: 100, wantRatio: 1.5, wantOK: true},
+		{name: "no limit configured", activeConnections: 50, connectionLimit: 0, wantRatio: 0, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratio, ok := connectionSaturationRatio(tt.activeConnections, tt.connectionLimit)
+			if ok != tt.wantOK || ratio != tt.wantRatio {
+				t.Errorf("connectionSaturationRatio(%d, %d) = (%v, %v), want (%v, %v)",
+					tt.activeConnections, tt.connectionLimit, ratio, ok, tt.wantRatio, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Package config loads the per-module credentials used by the exporter's
+// /probe endpoint, following the blackbox_exporter / snmp_exporter
+// --config.file convention.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Module holds everything needed to reach and authenticate against a single
+// Kemp LoadMaster. A config file can define several modules so that targets
+// with different credentials can share one exporter.
+type Module struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Timeout  int    `yaml:"timeout"`
+}
+
+// Config is the top-level structure of --config.file.
+type Config struct {
+	Modules map[string]Module `yaml:"modules"`
+}
+
+// Load reads and parses a config file from disk.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Module looks up a module by name, returning an error if it isn't defined.
+func (c *Config) Module(name string) (Module, error) {
+	module, ok := c.Modules[name]
+	if !ok {
+		return Module{}, fmt.Errorf("unknown module %q", name)
+	}
+
+	return module, nil
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadAndModule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kemp-exporter.yml")
+	data := []byte(`
+modules:
+  default:
+    username: admin
+    password: secret
+    timeout: 15
+`)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	module, err := cfg.Module("default")
+	if err != nil {
+		t.Fatalf("Module(\"default\") error = %v", err)
+	}
+	want := Module{Username: "admin", Password: "secret", Timeout: 15}
+	if module != want {
+		t.Errorf("Module(\"default\") = %+v, want %+v", module, want)
+	}
+
+	if _, err := cfg.Module("nonexistent"); err == nil {
+		t.Error("Module(\"nonexistent\") error = nil, want an error")
+	}
+}